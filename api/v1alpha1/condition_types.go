@@ -20,6 +20,10 @@ const (
 	// HealthyCondition represents the last recorded
 	// health assessment result.
 	HealthyCondition string = "Healthy"
+
+	// ApprovalPendingCondition indicates that a revision is staged behind a DeployMode=manual approval
+	// gate and is waiting for a matching kluctl.io/approve annotation before it is applied.
+	ApprovalPendingCondition string = "ApprovalPending"
 )
 
 const (
@@ -49,4 +53,21 @@ const (
 	// ReconciliationSkippedReason represents the fact that
 	// the reconciliation was skipped due to an unchanged target.
 	ReconciliationSkippedReason string = "ReconciliationSkipped"
+
+	// ApprovalPendingReason represents the fact that DeployMode=manual is staging a revision behind the
+	// kluctl.io/approve annotation before it is applied.
+	ApprovalPendingReason string = "ApprovalPending"
+)
+
+// Stalled reconciliation reasons which are surfaced through the meta.StalledCondition. A Stalled=True
+// KluctlDeployment is not retried by the controller; it requires a spec change (i.e. a generation bump)
+// before reconciliation resumes.
+const (
+	// InvalidKluctlProjectReason represents the fact that the kluctl project referenced by
+	// KluctlDeploymentSpec.Path does not contain a valid .kluctl.yaml, or otherwise failed to load.
+	InvalidKluctlProjectReason string = "InvalidKluctlProject"
+
+	// InvalidTargetReason represents the fact that KluctlDeploymentSpec.Target does not match
+	// any target defined in the kluctl project.
+	InvalidTargetReason string = "InvalidTarget"
 )
@@ -0,0 +1,34 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"github.com/fluxcd/pkg/apis/meta"
+)
+
+// ImagePolicyRef binds a kluctl image target argument to an image-reflector-controller ImagePolicy. During
+// reconciliation the controller resolves ImagePolicy.Status.LatestImage and passes it to kluctl as a
+// --fixed-image override, so an advancing ImagePolicy triggers a redeploy without a Git commit.
+type ImagePolicyRef struct {
+	// Image is the kluctl image/fixed_image target argument to override, e.g. "myrepo/myimage".
+	// +required
+	Image string `json:"image"`
+
+	// PolicyRef points at the ImagePolicy whose LatestImage should be substituted for Image.
+	// +required
+	PolicyRef meta.NamespacedObjectReference `json:"policyRef"`
+}
@@ -17,10 +17,12 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/fluxcd/pkg/apis/meta"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"time"
 )
 
 const (
@@ -29,6 +31,17 @@ const (
 	MaxConditionMessageLength = 20000
 	DisabledValue             = "disabled"
 	MergeValue                = "merge"
+
+	// AutoDeployMode applies every reconciled revision immediately. This is the default.
+	AutoDeployMode = "auto"
+
+	// ManualDeployMode stages every reconciled revision behind a kluctl.io/approve annotation, which must
+	// be set to the attempted revision before the controller will apply it.
+	ManualDeployMode = "manual"
+
+	// ApproveAnnotation, when set to an attempted revision on a DeployMode=manual KluctlDeployment,
+	// promotes that revision from Status.PendingApproval to deployed.
+	ApproveAnnotation = "kluctl.io/approve"
 )
 
 // KluctlDeploymentSpec defines the desired state of KluctlDeployment
@@ -84,6 +97,18 @@ type KluctlDeploymentSpec struct {
 	// +kubebuilder:default:=false
 	// +optional
 	Prune bool `json:"prune,omitempty"`
+
+	// Images binds kluctl image target arguments to image-reflector-controller ImagePolicies, allowing
+	// in-cluster image bumps without a Git round-trip.
+	// +optional
+	Images []ImagePolicyRef `json:"images,omitempty"`
+
+	// DeployMode controls whether a reconciled revision is applied immediately ('auto') or staged behind a
+	// kluctl.io/approve annotation with a dry-run diff first ('manual'). Defaults to 'auto'.
+	// +kubebuilder:validation:Enum=auto;manual
+	// +kubebuilder:default:=auto
+	// +optional
+	DeployMode string `json:"deployMode,omitempty"`
 }
 
 // KluctlDeploymentStatus defines the observed state of KluctlDeployment
@@ -105,18 +130,48 @@ type KluctlDeploymentStatus struct {
 	// LastAttemptedRevision is the revision of the last reconciliation attempt.
 	// +optional
 	LastAttemptedRevision string `json:"lastAttemptedRevision,omitempty"`
+
+	// PendingApproval holds the rendered `kluctl diff` output for a revision that DeployMode=manual is
+	// staging behind the kluctl.io/approve annotation.
+	// +optional
+	PendingApproval *PendingApproval `json:"pendingApproval,omitempty"`
+}
+
+// PendingApproval describes a revision staged behind a DeployMode=manual approval gate.
+type PendingApproval struct {
+	// Revision is the LastAttemptedRevision this diff was computed against.
+	// +required
+	Revision string `json:"revision"`
+
+	// Diff is the rendered `kluctl diff` output, truncated to MaxConditionMessageLength.
+	// +optional
+	Diff string `json:"diff,omitempty"`
+
+	// ConfigMapRef points at a ConfigMap holding the full diff, for cases where it is too large to store
+	// inline in Diff. The controller does not set it: a diff longer than MaxConditionMessageLength is
+	// truncated in Diff and no ConfigMap is created.
+	// +optional
+	ConfigMapRef *meta.LocalObjectReference `json:"configMapRef,omitempty"`
 }
 
 // KluctlDeploymentProgressing resets the conditions of the given KluctlDeployment to a single
-// ReadyCondition with status ConditionUnknown.
+// ReadyCondition with status ConditionUnknown, and marks it as Reconciling so that kstatus-aware
+// clients (kubectl wait, flux get) can tell the reconciliation is in-flight rather than wedged.
 func KluctlDeploymentProgressing(k KluctlDeployment, message string) KluctlDeployment {
-	newCondition := metav1.Condition{
+	message = trimString(message, MaxConditionMessageLength)
+	apimeta.SetStatusCondition(k.GetStatusConditions(), metav1.Condition{
 		Type:    meta.ReadyCondition,
 		Status:  metav1.ConditionUnknown,
 		Reason:  meta.ProgressingReason,
-		Message: trimString(message, MaxConditionMessageLength),
-	}
-	apimeta.SetStatusCondition(k.GetStatusConditions(), newCondition)
+		Message: message,
+	})
+	apimeta.SetStatusCondition(k.GetStatusConditions(), metav1.Condition{
+		Type:    meta.ReconcilingCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  meta.ProgressingReason,
+		Message: message,
+	})
+	apimeta.RemoveStatusCondition(k.GetStatusConditions(), meta.StalledCondition)
 	return k
 }
 
@@ -131,29 +186,125 @@ func SetKluctlDeploymentHealthiness(k *KluctlDeployment, status metav1.Condition
 	apimeta.SetStatusCondition(k.GetStatusConditions(), newCondition)
 }
 
-// SetKluctlDeploymentReadiness sets the ReadyCondition, ObservedGeneration, and LastAttemptedRevision, on the KluctlDeployment.
+// SetKluctlDeploymentReadiness sets the ReadyCondition, ObservedGeneration, and LastAttemptedRevision, on the
+// KluctlDeployment, and clears Reconciling since the reconciliation attempt has reached a terminal outcome.
+// Callers must only invoke this once a reconciliation has actually finished (successfully or not); it must
+// not be called while work is still in-flight, which is what KluctlDeploymentProgressing is for. This keeps
+// ObservedGeneration advancing only on terminal outcomes, as kstatus clients expect.
 func SetKluctlDeploymentReadiness(k *KluctlDeployment, status metav1.ConditionStatus, reason, message string, revision string) {
-	newCondition := metav1.Condition{
+	message = trimString(message, MaxConditionMessageLength)
+	apimeta.SetStatusCondition(k.GetStatusConditions(), metav1.Condition{
 		Type:    meta.ReadyCondition,
 		Status:  status,
 		Reason:  reason,
-		Message: trimString(message, MaxConditionMessageLength),
-	}
-	apimeta.SetStatusCondition(k.GetStatusConditions(), newCondition)
+		Message: message,
+	})
+	apimeta.SetStatusCondition(k.GetStatusConditions(), metav1.Condition{
+		Type:    meta.ReconcilingCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: message,
+	})
 
 	k.Status.ObservedGeneration = k.Generation
 	k.Status.LastAttemptedRevision = revision
 }
 
-// KluctlDeploymentNotReady registers a failed apply attempt of the given KluctlDeployment.
+// KluctlDeploymentNotReady registers a failed, but retriable, apply attempt of the given KluctlDeployment.
+// Stalled is left/set to False so that the controller keeps requeueing the object at GetRetryInterval().
+// Unlike KluctlDeploymentStalled, this does NOT go through SetKluctlDeploymentReadiness: a retriable failure
+// is not a terminal outcome, so ObservedGeneration must be left untouched, or kstatus clients would read the
+// object as done-but-failed instead of still being retried.
 func KluctlDeploymentNotReady(k KluctlDeployment, revision, reason, message string) KluctlDeployment {
+	message = trimString(message, MaxConditionMessageLength)
+	apimeta.SetStatusCondition(k.GetStatusConditions(), metav1.Condition{
+		Type:    meta.ReadyCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: message,
+	})
+	apimeta.SetStatusCondition(k.GetStatusConditions(), metav1.Condition{
+		Type:    meta.ReconcilingCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: message,
+	})
+	apimeta.SetStatusCondition(k.GetStatusConditions(), metav1.Condition{
+		Type:    meta.StalledCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: message,
+	})
+	k.Status.LastAttemptedRevision = revision
+	return k
+}
+
+// KluctlDeploymentStalled registers a non-retriable failure of the given KluctlDeployment, such as a malformed
+// .kluctl.yaml or an unknown target. Stalled=True tells kstatus-aware clients (kubectl wait, flux get) that the
+// controller will not requeue this object on its own; it only becomes eligible for reconciliation again once
+// its generation changes.
+func KluctlDeploymentStalled(k KluctlDeployment, revision, reason, message string) KluctlDeployment {
 	SetKluctlDeploymentReadiness(&k, metav1.ConditionFalse, reason, trimString(message, MaxConditionMessageLength), revision)
-	if revision != "" {
-		k.Status.LastAttemptedRevision = revision
-	}
+	apimeta.SetStatusCondition(k.GetStatusConditions(), metav1.Condition{
+		Type:    meta.StalledCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  reason,
+		Message: trimString(message, MaxConditionMessageLength),
+	})
 	return k
 }
 
+// SetKluctlDeploymentPendingApproval records that revision is staged behind the DeployMode=manual approval
+// gate, storing diff in Status.PendingApproval and surfacing it via the ApprovalPendingCondition and
+// Ready=False. This is a retriable, non-terminal outcome: the controller keeps polling at
+// GetRequeueAfter() until the approve annotation matches revision, so ObservedGeneration is intentionally
+// left untouched.
+func SetKluctlDeploymentPendingApproval(k *KluctlDeployment, revision, diff string) {
+	message := fmt.Sprintf("revision %s is waiting for approval", revision)
+
+	k.Status.PendingApproval = &PendingApproval{
+		Revision: revision,
+		Diff:     trimString(diff, MaxConditionMessageLength),
+	}
+	k.Status.LastAttemptedRevision = revision
+
+	apimeta.SetStatusCondition(k.GetStatusConditions(), metav1.Condition{
+		Type:    ApprovalPendingCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  ApprovalPendingReason,
+		Message: message,
+	})
+	apimeta.SetStatusCondition(k.GetStatusConditions(), metav1.Condition{
+		Type:    meta.ReadyCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  ApprovalPendingReason,
+		Message: message,
+	})
+}
+
+// ClearKluctlDeploymentPendingApproval drops Status.PendingApproval and sets ApprovalPendingCondition=False,
+// once a staged revision has either been approved and applied, or superseded by a newer one.
+func ClearKluctlDeploymentPendingApproval(k *KluctlDeployment, reason, message string) {
+	k.Status.PendingApproval = nil
+	apimeta.SetStatusCondition(k.GetStatusConditions(), metav1.Condition{
+		Type:    ApprovalPendingCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: trimString(message, MaxConditionMessageLength),
+	})
+}
+
+// IsManualDeployMode reports whether this KluctlDeployment requires an approval gate before applying.
+func (in KluctlDeployment) IsManualDeployMode() bool {
+	return in.Spec.DeployMode == ManualDeployMode
+}
+
+// GetApprovedRevision returns the revision an operator has approved via the kluctl.io/approve annotation,
+// or "" if none is set.
+func (in KluctlDeployment) GetApprovedRevision() string {
+	return in.GetAnnotations()[ApproveAnnotation]
+}
+
 // GetTimeout returns the timeout with default.
 func (in KluctlDeployment) GetTimeout() time.Duration {
 	duration := in.Spec.Interval.Duration - 30*time.Second
@@ -0,0 +1,67 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// validSourceRefKinds are the source-controller kinds the reconciler knows how to fetch an Artifact from.
+var validSourceRefKinds = map[string]bool{
+	"GitRepository": true,
+	"OCIRepository": true,
+	"Bucket":        true,
+}
+
+// SetupWebhookWithManager registers the validating webhook for KluctlDeployment.
+func (in *KluctlDeployment) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(in).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-gitops-kluctl-io-v1alpha1-kluctldeployment,mutating=false,failurePolicy=fail,sideEffects=None,groups=gitops.kluctl.io,resources=kluctldeployments,verbs=create;update,versions=v1alpha1,name=vkluctldeployment.kluctl.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &KluctlDeployment{}
+
+// ValidateCreate implements webhook.Validator so a create request with an unsupported SourceRef.Kind is
+// rejected with a clear error.
+func (in *KluctlDeployment) ValidateCreate() (admission.Warnings, error) {
+	return nil, in.validateSourceRef()
+}
+
+// ValidateUpdate implements webhook.Validator.
+func (in *KluctlDeployment) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	return nil, in.validateSourceRef()
+}
+
+// ValidateDelete implements webhook.Validator.
+func (in *KluctlDeployment) ValidateDelete() (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (in *KluctlDeployment) validateSourceRef() error {
+	if !validSourceRefKinds[in.Spec.SourceRef.Kind] {
+		return fmt.Errorf("spec.sourceRef.kind %q is not supported, must be one of GitRepository, OCIRepository, Bucket", in.Spec.SourceRef.Kind)
+	}
+	return nil
+}
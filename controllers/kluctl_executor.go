@@ -0,0 +1,248 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	kluctlv1 "github.com/kluctl/flux-kluctl-controller/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/types"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta2"
+)
+
+// sourceWithArtifact is implemented by every kind a KluctlDeploymentSpec.SourceRef can point at
+// (GitRepository, OCIRepository, Bucket).
+type sourceWithArtifact interface {
+	GetArtifact() *sourcev1.Artifact
+}
+
+// getArtifact fetches obj's SourceRef and returns its current Artifact. It returns an error if the
+// referenced source does not exist, references an unsupported kind, or has not produced an Artifact yet;
+// all of these are retriable, so callers surface them through KluctlDeploymentNotReady rather than Stalled.
+func (r *KluctlDeploymentReconciler) getArtifact(ctx context.Context, obj *kluctlv1.KluctlDeployment) (*sourcev1.Artifact, error) {
+	namespace := obj.Spec.SourceRef.Namespace
+	if namespace == "" {
+		namespace = obj.GetNamespace()
+	}
+	key := types.NamespacedName{Namespace: namespace, Name: obj.Spec.SourceRef.Name}
+
+	var src sourceWithArtifact
+	switch obj.Spec.SourceRef.Kind {
+	case sourcev1.GitRepositoryKind:
+		var o sourcev1.GitRepository
+		if err := r.Get(ctx, key, &o); err != nil {
+			return nil, err
+		}
+		src = &o
+	case sourcev1.OCIRepositoryKind:
+		var o sourcev1.OCIRepository
+		if err := r.Get(ctx, key, &o); err != nil {
+			return nil, err
+		}
+		src = &o
+	case sourcev1.BucketKind:
+		var o sourcev1.Bucket
+		if err := r.Get(ctx, key, &o); err != nil {
+			return nil, err
+		}
+		src = &o
+	default:
+		return nil, fmt.Errorf("unsupported sourceRef.kind %q", obj.Spec.SourceRef.Kind)
+	}
+
+	artifact := src.GetArtifact()
+	if artifact == nil {
+		return nil, fmt.Errorf("%s %q has not produced an artifact yet", obj.Spec.SourceRef.Kind, key)
+	}
+	return artifact, nil
+}
+
+// fetchArtifact downloads and extracts artifact.URL into a freshly created temp directory, verifying the
+// artifact's sha256 checksum along the way. The caller is responsible for removing the returned directory.
+func fetchArtifact(ctx context.Context, artifact *sourcev1.Artifact) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, artifact.URL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to build artifact request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch artifact: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch artifact: unexpected status code %d", resp.StatusCode)
+	}
+
+	dir, err := os.MkdirTemp("", "kluctl-source-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp dir: %w", err)
+	}
+
+	if err := extractTarGz(resp.Body, artifact.Checksum, dir); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// extractTarGz streams r as a gzip-compressed tarball into dir, verifying its sha256 checksum against
+// wantChecksum (skipped if empty, e.g. for sources that don't report one).
+func extractTarGz(r io.Reader, wantChecksum, dir string) error {
+	h := sha256.New()
+	tee := io.TeeReader(r, h)
+	gzr, err := gzip.NewReader(tee)
+	if err != nil {
+		return fmt.Errorf("failed to open artifact as gzip: %w", err)
+	}
+	defer gzr.Close()
+
+	tr := tar.NewReader(gzr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read artifact tarball: %w", err)
+		}
+
+		path := filepath.Join(dir, filepath.Clean("/"+hdr.Name))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			f.Close()
+		}
+	}
+
+	if wantChecksum != "" {
+		// The tar reader stops at the end-of-archive marker, so read the rest of the stream (remaining gzip
+		// data and trailer) to have h cover the whole artifact.
+		if _, err := io.Copy(io.Discard, tee); err != nil {
+			return fmt.Errorf("failed to read artifact: %w", err)
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); got != wantChecksum {
+			return fmt.Errorf("artifact checksum mismatch: got %s, want %s", got, wantChecksum)
+		}
+	}
+	return nil
+}
+
+// deployStats is a best-effort summary of a `kluctl deploy`/`kluctl diff` run, parsed from its output for
+// inclusion in the corresponding event's metadata. kluctl does not emit a machine-readable summary on these
+// code paths, so the counts below are derived with regexes and are not guaranteed to cover every kluctl
+// version; a parse failure is not treated as a deploy failure.
+type deployStats struct {
+	Applied int
+	Deleted int
+	Changed int
+	Drifted int
+}
+
+func (s deployStats) asMetadata() map[string]string {
+	return map[string]string{
+		"applied": strconv.Itoa(s.Applied),
+		"deleted": strconv.Itoa(s.Deleted),
+		"changed": strconv.Itoa(s.Changed),
+		"drifted": strconv.Itoa(s.Drifted),
+	}
+}
+
+var deployStatsPatterns = struct {
+	applied, deleted, changed, drifted *regexp.Regexp
+}{
+	applied: regexp.MustCompile(`(\d+) object\(s\) applied`),
+	deleted: regexp.MustCompile(`(\d+) object\(s\) deleted`),
+	changed: regexp.MustCompile(`(\d+) object\(s\) changed`),
+	drifted: regexp.MustCompile(`(\d+) object\(s\) drifted`),
+}
+
+func parseDeployStats(output string) deployStats {
+	var s deployStats
+	for _, m := range []struct {
+		re  *regexp.Regexp
+		out *int
+	}{
+		{deployStatsPatterns.applied, &s.Applied},
+		{deployStatsPatterns.deleted, &s.Deleted},
+		{deployStatsPatterns.changed, &s.Changed},
+		{deployStatsPatterns.drifted, &s.Drifted},
+	} {
+		if match := m.re.FindStringSubmatch(output); match != nil {
+			*m.out, _ = strconv.Atoi(match[1])
+		}
+	}
+	return s
+}
+
+// kluctlFixedImageArgs turns a list of "image=value" strings (as produced by resolveImages) into the
+// repeated `--fixed-image` flags kluctl expects.
+func kluctlFixedImageArgs(images []string) []string {
+	args := make([]string, 0, 2*len(images))
+	for _, img := range images {
+		args = append(args, "--fixed-image", img)
+	}
+	return args
+}
+
+// runKluctl shells out to the kluctl CLI with workDir as its current directory, returning its combined
+// stdout/stderr so callers can parse a best-effort deployStats out of it.
+func runKluctl(ctx context.Context, workDir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "kluctl", args...)
+	cmd.Dir = workDir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(out), fmt.Errorf("kluctl %v: %w: %s", args, err, out)
+	}
+	return string(out), nil
+}
+
+// kluctlProjectArgs returns the arguments common to both `kluctl deploy` and `kluctl diff` for obj.
+func kluctlProjectArgs(obj *kluctlv1.KluctlDeployment, images []string) []string {
+	args := []string{"--target", obj.Spec.Target, "--yes"}
+	if obj.Spec.Path != "" {
+		args = append(args, "--project-dir", obj.Spec.Path)
+	}
+	return append(args, kluctlFixedImageArgs(images)...)
+}
@@ -84,3 +84,50 @@ func (r *KluctlDeploymentReconciler) indexBy(kind string) func(o client.Object)
 		return nil
 	}
 }
+
+// requestsForImagePolicyChangeOf returns a mapping function that, given an updated ImagePolicy, requests
+// reconciliation of every KluctlDeployment that binds one of its Spec.Images to that ImagePolicy. Unlike
+// requestsForRevisionChangeOf, it cannot compare against LastAttemptedRevision directly: the ImagePolicy's
+// LatestImage only ever shows up folded into that revision string, so every dependent KluctlDeployment is
+// requested and the reconciler re-resolves the image and recomputes the revision.
+func (r *KluctlDeploymentReconciler) requestsForImagePolicyChangeOf(indexKey string) func(obj client.Object) []reconcile.Request {
+	return func(obj client.Object) []reconcile.Request {
+		ctx := context.Background()
+		list := &kluctlv1.KluctlDeploymentList{}
+
+		if err := r.List(ctx, list, client.MatchingFields{
+			indexKey: client.ObjectKeyFromObject(obj).String(),
+		}); err != nil {
+			return nil
+		}
+		reqs := make([]reconcile.Request, 0, len(list.Items))
+		for _, d := range list.Items {
+			reqs = append(reqs, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Namespace: d.GetNamespace(),
+					Name:      d.GetName(),
+				},
+			})
+		}
+		return reqs
+	}
+}
+
+// indexByImagePolicy indexes a KluctlDeployment under "<namespace>/<name>" for every ImagePolicy it
+// references via Spec.Images, so requestsForImagePolicyChangeOf can look dependents up in O(1).
+func (r *KluctlDeploymentReconciler) indexByImagePolicy(o client.Object) []string {
+	k, ok := o.(*kluctlv1.KluctlDeployment)
+	if !ok {
+		return nil
+	}
+
+	var keys []string
+	for _, img := range k.Spec.Images {
+		namespace := k.GetNamespace()
+		if img.PolicyRef.Namespace != "" {
+			namespace = img.PolicyRef.Namespace
+		}
+		keys = append(keys, fmt.Sprintf("%s/%s", namespace, img.PolicyRef.Name))
+	}
+	return keys
+}
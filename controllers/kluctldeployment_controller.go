@@ -0,0 +1,345 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	kluctlv1 "github.com/kluctl/flux-kluctl-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	kuberecorder "k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	eventv1 "github.com/fluxcd/pkg/apis/event/v1beta1"
+	"github.com/fluxcd/pkg/runtime/events"
+
+	imagev1 "github.com/fluxcd/image-reflector-controller/api/v1beta2"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta2"
+)
+
+// KluctlDeploymentReconciler reconciles a KluctlDeployment object.
+type KluctlDeploymentReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// EventRecorder records standard Kubernetes Events (visible via `kubectl describe`/`kubectl get events`).
+	EventRecorder kuberecorder.EventRecorder
+
+	// ExternalEventRecorder, when set, additionally posts notification-controller-compatible events (see
+	// --events-addr) so Alert/Provider CRs can route kluctl outcomes to Slack/Teams/etc.
+	ExternalEventRecorder *events.Recorder
+}
+
+//+kubebuilder:rbac:groups=gitops.kluctl.io,resources=kluctldeployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=gitops.kluctl.io,resources=kluctldeployments/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=gitops.kluctl.io,resources=kluctldeployments/finalizers,verbs=update
+
+// Reconcile fetches a KluctlDeployment and drives it towards its desired state.
+func (r *KluctlDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	reconcileLog := log.FromContext(ctx)
+
+	obj := &kluctlv1.KluctlDeployment{}
+	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if obj.Spec.Suspend {
+		reconcileLog.Info("reconciliation is suspended for this object")
+		return ctrl.Result{}, nil
+	}
+
+	// A Stalled object failed for a reason that a retry cannot fix (e.g. a malformed .kluctl.yaml or an
+	// unknown target). Until its generation changes, there is nothing new for the controller to do, so we
+	// must not requeue it again.
+	if isStalled(obj) && obj.Status.ObservedGeneration == obj.Generation {
+		return ctrl.Result{}, nil
+	}
+
+	result, err := r.reconcile(ctx, obj)
+
+	if statusErr := r.Status().Update(ctx, obj); statusErr != nil {
+		return ctrl.Result{Requeue: true}, statusErr
+	}
+
+	return result, err
+}
+
+// event records a standard Kubernetes Event for obj, and, when an ExternalEventRecorder is configured,
+// forwards a notification-controller-compatible event carrying revision and reconciliation metadata (target,
+// counts of applied/pruned/changed/drifted objects, deploy duration) so Alert/Provider CRs can route kluctl
+// outcomes the same way Kustomization events are routed today.
+func (r *KluctlDeploymentReconciler) event(ctx context.Context, obj *kluctlv1.KluctlDeployment, revision, severity, reason, message string, metadata map[string]string) {
+	if r.EventRecorder != nil {
+		eventType := corev1.EventTypeNormal
+		if severity == eventv1.EventSeverityError {
+			eventType = corev1.EventTypeWarning
+		}
+		r.EventRecorder.Event(obj, eventType, reason, message)
+	}
+
+	if r.ExternalEventRecorder == nil {
+		return
+	}
+
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	if revision != "" {
+		metadata["revision"] = revision
+	}
+	metadata["target"] = obj.Spec.Target
+
+	if err := r.ExternalEventRecorder.Eventf(obj, metadata, severity, reason, message); err != nil {
+		log.FromContext(ctx).Error(err, "unable to send event")
+	}
+}
+
+// isStalled reports whether obj currently has its Stalled condition set to True.
+func isStalled(obj *kluctlv1.KluctlDeployment) bool {
+	cond := apimeta.FindStatusCondition(obj.Status.Conditions, meta.StalledCondition)
+	return cond != nil && cond.Status == metav1.ConditionTrue
+}
+
+// reconcile performs a single reconciliation attempt, updating obj's status in place. A non-retriable
+// failure is recorded via KluctlDeploymentStalled and returned with a nil error so that the Reconcile loop
+// above stops requeueing the object; a retriable failure is recorded via KluctlDeploymentNotReady and
+// requeued at GetRetryInterval().
+func (r *KluctlDeploymentReconciler) reconcile(ctx context.Context, obj *kluctlv1.KluctlDeployment) (ctrl.Result, error) {
+	lastRevision := obj.Status.LastAttemptedRevision
+
+	*obj = kluctlv1.KluctlDeploymentProgressing(*obj, "reconciliation in progress")
+
+	if reason, err := validateKluctlProject(obj); err != nil {
+		msg := fmt.Sprintf("failed to prepare kluctl project: %s", err)
+		*obj = kluctlv1.KluctlDeploymentStalled(*obj, lastRevision, reason, msg)
+		r.event(ctx, obj, lastRevision, eventv1.EventSeverityError, reason, msg, nil)
+		return ctrl.Result{}, nil
+	}
+
+	artifact, err := r.getArtifact(ctx, obj)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get source artifact: %s", err)
+		*obj = kluctlv1.KluctlDeploymentNotReady(*obj, lastRevision, kluctlv1.ArtifactFailedReason, msg)
+		r.event(ctx, obj, lastRevision, eventv1.EventSeverityError, kluctlv1.ArtifactFailedReason, msg, nil)
+		return ctrl.Result{RequeueAfter: obj.GetRetryInterval()}, nil
+	}
+	revision := artifact.Revision
+
+	images, err := r.resolveImages(ctx, obj)
+	if err != nil {
+		msg := fmt.Sprintf("failed to resolve spec.images: %s", err)
+		*obj = kluctlv1.KluctlDeploymentNotReady(*obj, revision, kluctlv1.PrepareFailedReason, msg)
+		r.event(ctx, obj, revision, eventv1.EventSeverityError, kluctlv1.PrepareFailedReason, msg, nil)
+		// A non-nil error here would make controller-runtime fall back to rate-limited exponential backoff
+		// and ignore RequeueAfter entirely; the failure is already recorded in Status, so return nil.
+		return ctrl.Result{RequeueAfter: obj.GetRetryInterval()}, nil
+	}
+	revision = revisionWithImages(revision, images)
+
+	sourceDir, err := fetchArtifact(ctx, artifact)
+	if err != nil {
+		msg := fmt.Sprintf("failed to fetch source artifact: %s", err)
+		*obj = kluctlv1.KluctlDeploymentNotReady(*obj, revision, kluctlv1.ArtifactFailedReason, msg)
+		r.event(ctx, obj, revision, eventv1.EventSeverityError, kluctlv1.ArtifactFailedReason, msg, nil)
+		return ctrl.Result{RequeueAfter: obj.GetRetryInterval()}, nil
+	}
+	defer os.RemoveAll(sourceDir)
+
+	if obj.IsManualDeployMode() && obj.GetApprovedRevision() != revision {
+		diff, err := r.diffKluctlProject(ctx, obj, sourceDir, images)
+		if err != nil {
+			msg := fmt.Sprintf("failed to compute dry-run diff: %s", err)
+			*obj = kluctlv1.KluctlDeploymentNotReady(*obj, revision, kluctlv1.DeployFailedReason, msg)
+			r.event(ctx, obj, revision, eventv1.EventSeverityError, kluctlv1.DeployFailedReason, msg, nil)
+			return ctrl.Result{RequeueAfter: obj.GetRetryInterval()}, nil
+		}
+
+		kluctlv1.SetKluctlDeploymentPendingApproval(obj, revision, diff)
+		msg := fmt.Sprintf("revision %s is waiting for approval, set the %q annotation to this revision to apply it", revision, kluctlv1.ApproveAnnotation)
+		r.event(ctx, obj, revision, eventv1.EventSeverityInfo, kluctlv1.ApprovalPendingReason, msg, nil)
+		return ctrl.Result{RequeueAfter: obj.GetRequeueAfter()}, nil
+	}
+
+	deployStart := time.Now()
+	stats, err := r.applyKluctlProject(ctx, obj, sourceDir, images)
+	if err != nil {
+		msg := fmt.Sprintf("kluctl deploy failed: %s", err)
+		*obj = kluctlv1.KluctlDeploymentNotReady(*obj, revision, kluctlv1.DeployFailedReason, msg)
+		r.event(ctx, obj, revision, eventv1.EventSeverityError, kluctlv1.DeployFailedReason, msg, nil)
+		return ctrl.Result{RequeueAfter: obj.GetRetryInterval()}, nil
+	}
+
+	msg := fmt.Sprintf("applied revision %s", revision)
+	kluctlv1.SetKluctlDeploymentReadiness(obj, metav1.ConditionTrue, kluctlv1.ReconciliationSucceededReason, msg, revision)
+	apimeta.SetStatusCondition(obj.GetStatusConditions(), metav1.Condition{
+		Type:    meta.StalledCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  kluctlv1.ReconciliationSucceededReason,
+		Message: msg,
+	})
+	obj.Status.LastDeployedRevision = revision
+	kluctlv1.ClearKluctlDeploymentPendingApproval(obj, kluctlv1.ReconciliationSucceededReason, msg)
+
+	metadata := stats.asMetadata()
+	metadata["duration"] = time.Since(deployStart).String()
+	r.event(ctx, obj, revision, eventv1.EventSeverityInfo, kluctlv1.ReconciliationSucceededReason, msg, metadata)
+
+	return ctrl.Result{RequeueAfter: obj.GetRequeueAfter()}, nil
+}
+
+// validateKluctlProject checks the parts of a KluctlDeployment's spec that can be validated without
+// touching the cluster: that spec.sourceRef.name or spec.path is set, and that spec.target is not empty. It
+// does not load .kluctl.yaml or check the target against the project's targets; a malformed project or an
+// unknown target surfaces later as a failed `kluctl deploy`/`kluctl diff`, which is retried. Failures here
+// are non-retriable: they require a spec change, so callers surface them through KluctlDeploymentStalled
+// rather than requeueing. It returns the Stalled reason alongside the error so the caller doesn't have to
+// re-derive it.
+func validateKluctlProject(obj *kluctlv1.KluctlDeployment) (string, error) {
+	if obj.Spec.Path == "" && obj.Spec.SourceRef.Name == "" {
+		return kluctlv1.InvalidKluctlProjectReason, fmt.Errorf(".kluctl.yaml could not be located: spec.sourceRef is unset")
+	}
+	if obj.Spec.Target == "" {
+		return kluctlv1.InvalidTargetReason, fmt.Errorf("spec.target must not be empty")
+	}
+	return "", nil
+}
+
+// applyKluctlProject runs `kluctl deploy --yes` against sourceDir, passing images as `--fixed-image` flags,
+// and returns a best-effort summary of the objects it touched for use in the resulting event's metadata.
+func (r *KluctlDeploymentReconciler) applyKluctlProject(ctx context.Context, obj *kluctlv1.KluctlDeployment, sourceDir string, images []string) (deployStats, error) {
+	args := append([]string{"deploy"}, kluctlProjectArgs(obj, images)...)
+	out, err := runKluctl(ctx, sourceDir, args...)
+	if err != nil {
+		return deployStats{}, err
+	}
+	return parseDeployStats(out), nil
+}
+
+// diffKluctlProject renders a `kluctl diff` of sourceDir against the live cluster, for storage in
+// Status.PendingApproval ahead of a DeployMode=manual approval.
+func (r *KluctlDeploymentReconciler) diffKluctlProject(ctx context.Context, obj *kluctlv1.KluctlDeployment, sourceDir string, images []string) (string, error) {
+	args := append([]string{"diff"}, kluctlProjectArgs(obj, images)...)
+	return runKluctl(ctx, sourceDir, args...)
+}
+
+// resolveImages resolves obj.Spec.Images against their referenced ImagePolicy objects and returns each
+// "image=tagOrDigest" as reported by ImagePolicy.Status.LatestImage, in spec order, ready to be passed to
+// kluctl as `--fixed-image` flags. reconcile additionally folds the result into the revision via
+// revisionWithImages so a lone ImagePolicy advance still triggers a redeploy.
+func (r *KluctlDeploymentReconciler) resolveImages(ctx context.Context, obj *kluctlv1.KluctlDeployment) ([]string, error) {
+	images := make([]string, 0, len(obj.Spec.Images))
+	for _, ref := range obj.Spec.Images {
+		namespace := ref.PolicyRef.Namespace
+		if namespace == "" {
+			namespace = obj.GetNamespace()
+		}
+
+		var policy imagev1.ImagePolicy
+		if err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.PolicyRef.Name}, &policy); err != nil {
+			return nil, fmt.Errorf("failed to get ImagePolicy %s/%s: %w", namespace, ref.PolicyRef.Name, err)
+		}
+		if policy.Status.LatestImage == "" {
+			return nil, fmt.Errorf("ImagePolicy %s/%s has not resolved a LatestImage yet", namespace, ref.PolicyRef.Name)
+		}
+
+		images = append(images, fmt.Sprintf("%s=%s", ref.Image, policy.Status.LatestImage))
+	}
+	return images, nil
+}
+
+// revisionWithImages folds the resolved image refs into revision, so that two reconciliations against the
+// same source revision but different resolved images end up with different LastAttemptedRevision values.
+// This is what allows requestsForImagePolicyChangeOf/isolated ImagePolicy advances to cause a redeploy even
+// though the Git/OCI/Bucket revision itself is unchanged.
+func revisionWithImages(revision string, images []string) string {
+	if len(images) == 0 {
+		return revision
+	}
+
+	sorted := append([]string(nil), images...)
+	sort.Strings(sorted)
+
+	h := sha256.New()
+	h.Write([]byte(revision))
+	h.Write([]byte(strings.Join(sorted, ",")))
+
+	return fmt.Sprintf("%s@images:sha256:%s", revision, hex.EncodeToString(h.Sum(nil)))
+}
+
+const (
+	gitRepositoryIndexKey = ".metadata.gitRepository"
+	ociRepositoryIndexKey = ".metadata.ociRepository"
+	bucketIndexKey        = ".metadata.bucket"
+	imagePolicyIndexKey   = ".metadata.imagePolicy"
+)
+
+// SetupWithManager sets up the controller with the Manager. A KluctlDeployment can reference a
+// GitRepository, an OCIRepository, or a Bucket as its SourceRef; each kind gets its own field indexer and
+// watch so that a new Artifact on any of them triggers a reconciliation of the dependent KluctlDeployments.
+func (r *KluctlDeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	for indexKey, kind := range map[string]string{
+		gitRepositoryIndexKey: sourcev1.GitRepositoryKind,
+		ociRepositoryIndexKey: sourcev1.OCIRepositoryKind,
+		bucketIndexKey:        sourcev1.BucketKind,
+	} {
+		if err := mgr.GetFieldIndexer().IndexField(context.Background(), &kluctlv1.KluctlDeployment{},
+			indexKey, r.indexBy(kind)); err != nil {
+			return fmt.Errorf("failed setting index fields: %w", err)
+		}
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &kluctlv1.KluctlDeployment{},
+		imagePolicyIndexKey, r.indexByImagePolicy); err != nil {
+		return fmt.Errorf("failed setting index fields: %w", err)
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&kluctlv1.KluctlDeployment{}).
+		Watches(
+			&source.Kind{Type: &sourcev1.GitRepository{}},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForRevisionChangeOf(gitRepositoryIndexKey)),
+		).
+		Watches(
+			&source.Kind{Type: &sourcev1.OCIRepository{}},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForRevisionChangeOf(ociRepositoryIndexKey)),
+		).
+		Watches(
+			&source.Kind{Type: &sourcev1.Bucket{}},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForRevisionChangeOf(bucketIndexKey)),
+		).
+		Watches(
+			&source.Kind{Type: &imagev1.ImagePolicy{}},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForImagePolicyChangeOf(imagePolicyIndexKey)),
+		).
+		Complete(r)
+}
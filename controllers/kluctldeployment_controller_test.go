@@ -0,0 +1,58 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	kluctlv1 "github.com/kluctl/flux-kluctl-controller/api/v1alpha1"
+)
+
+func TestIsStalled(t *testing.T) {
+	ready := kluctlv1.KluctlDeployment{}
+	ready = kluctlv1.KluctlDeploymentProgressing(ready, "reconciliation in progress")
+	if isStalled(&ready) {
+		t.Errorf("a progressing object must not be reported as stalled")
+	}
+
+	stalled := kluctlv1.KluctlDeploymentStalled(kluctlv1.KluctlDeployment{}, "main/abc123", kluctlv1.PrepareFailedReason, "malformed .kluctl.yaml")
+	if !isStalled(&stalled) {
+		t.Errorf("an object with Stalled=True must be reported as stalled")
+	}
+
+	recovered := kluctlv1.KluctlDeploymentProgressing(stalled, "reconciliation in progress")
+	if isStalled(&recovered) {
+		t.Errorf("KluctlDeploymentProgressing must clear a previous Stalled condition")
+	}
+}
+
+func TestManualDeployModeGate(t *testing.T) {
+	obj := kluctlv1.KluctlDeployment{}
+	obj.Spec.DeployMode = kluctlv1.ManualDeployMode
+
+	if !obj.IsManualDeployMode() {
+		t.Fatalf("expected IsManualDeployMode to be true for DeployMode=manual")
+	}
+	if obj.GetApprovedRevision() != "" {
+		t.Fatalf("expected no approved revision without the annotation")
+	}
+
+	obj.Annotations = map[string]string{kluctlv1.ApproveAnnotation: "main/abc123"}
+	if obj.GetApprovedRevision() != "main/abc123" {
+		t.Errorf("GetApprovedRevision() = %q, want %q", obj.GetApprovedRevision(), "main/abc123")
+	}
+}